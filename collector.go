@@ -0,0 +1,438 @@
+package soup
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// htmlCallback pairs a compiled selector with the function registered via
+// Collector.OnHTML.
+type htmlCallback struct {
+	sel selectorGroup
+	fn  func(Root)
+}
+
+// Response is the result of a single page visited by a Collector.
+type Response struct {
+	URL        string
+	StatusCode int
+	Body       string
+	Depth      int
+}
+
+// visit is a single unit of work queued onto a Collector's worker pool.
+type visit struct {
+	url   string
+	depth int
+}
+
+// Collector crawls pages starting from one or more seed URLs, dispatching
+// registered callbacks for matching elements on every page visited. It
+// composes on top of Get/HTMLParse and keeps its own configuration (rate
+// limit, depth, allowed domains, workers, retries) and its own Session
+// rather than relying on DefaultSession.
+type Collector struct {
+	MaxDepth       int
+	AllowedDomains []string
+	Workers        int
+	RateLimit      time.Duration
+	MaxRetries     int
+	Robots         *RobotsPolicy
+	Cache          Cache
+	Session        *Session
+
+	htmlCallbacks     []htmlCallback
+	responseCallbacks []func(Response)
+	errorCallbacks    []func(string, error)
+
+	mu      sync.Mutex
+	visited map[string]bool
+	hostHit map[string]time.Time
+
+	queue chan visit
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// CollectorOption configures a Collector created with NewCollector.
+type CollectorOption func(*Collector)
+
+// WithMaxDepth limits how many link-hops away from a seed URL the
+// Collector will follow. A depth of 0 (the default) only visits the
+// seed URLs themselves; pass -1 for unlimited depth.
+func WithMaxDepth(depth int) CollectorOption {
+	return func(c *Collector) { c.MaxDepth = depth }
+}
+
+// WithAllowedDomains restricts the Collector to only visiting URLs whose
+// host is in domains. If unset, all domains are allowed.
+func WithAllowedDomains(domains ...string) CollectorOption {
+	return func(c *Collector) { c.AllowedDomains = domains }
+}
+
+// WithWorkers sets the number of concurrent workers fetching pages. The
+// default is 1 (sequential crawling).
+func WithWorkers(n int) CollectorOption {
+	return func(c *Collector) { c.Workers = n }
+}
+
+// WithRateLimit sets the minimum delay between two requests to the same
+// host.
+func WithRateLimit(d time.Duration) CollectorOption {
+	return func(c *Collector) { c.RateLimit = d }
+}
+
+// WithMaxRetries sets how many times a failed request is retried, with
+// exponential backoff, before giving up and reporting the error.
+func WithMaxRetries(n int) CollectorOption {
+	return func(c *Collector) { c.MaxRetries = n }
+}
+
+// WithRobotsPolicy gates every visit (seed or discovered) through policy,
+// skipping URLs it disallows.
+func WithRobotsPolicy(policy *RobotsPolicy) CollectorOption {
+	return func(c *Collector) { c.Robots = policy }
+}
+
+// WithCache makes the Collector perform conditional GETs through cache,
+// so pages that haven't changed since the last crawl aren't
+// re-downloaded.
+func WithCache(cache Cache) CollectorOption {
+	return func(c *Collector) { c.Cache = cache }
+}
+
+// WithSession makes the Collector fetch through s instead of a Session
+// private to it, so its headers, cookies and User-Agent can be shared
+// with (or configured like) other code using s directly.
+func WithSession(s *Session) CollectorOption {
+	return func(c *Collector) { c.Session = s }
+}
+
+// NewCollector creates a Collector ready to have callbacks registered on
+// it and URLs visited. Unless overridden with WithSession, it fetches
+// through its own Session rather than DefaultSession, so headers,
+// cookies and User-Agent set on one Collector never leak into another.
+func NewCollector(opts ...CollectorOption) *Collector {
+
+	c := &Collector{
+		Workers: 1,
+		Session: NewSession(),
+		visited: make(map[string]bool),
+		hostHit: make(map[string]time.Time),
+		queue:   make(chan visit, 64),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+
+}
+
+// OnHTML registers fn to be called, with the matched element wrapped as a
+// Root, for every element matching selector on every page visited.
+func (c *Collector) OnHTML(selector string, fn func(Root)) error {
+	sel, err := compileSelector(selector)
+	if err != nil {
+		return err
+	}
+	c.htmlCallbacks = append(c.htmlCallbacks, htmlCallback{sel: sel, fn: fn})
+	return nil
+}
+
+// OnResponse registers fn to be called with the raw Response for every
+// page visited, before OnHTML callbacks run against it.
+func (c *Collector) OnResponse(fn func(Response)) {
+	c.responseCallbacks = append(c.responseCallbacks, fn)
+}
+
+// OnError registers fn to be called with the URL and error whenever a
+// visit fails after exhausting its retries.
+func (c *Collector) OnError(fn func(string, error)) {
+	c.errorCallbacks = append(c.errorCallbacks, fn)
+}
+
+// Visit enqueues url to be fetched and processed as a seed, at depth 0.
+// It is safe to call from within an OnHTML/OnResponse callback, but such
+// calls are also treated as seeds at depth 0; only the links the
+// Collector follows on its own (href of <a> elements) inherit depth+1
+// from the page they were found on.
+func (c *Collector) Visit(url string) error {
+	return c.visitAt(url, 0)
+}
+
+func (c *Collector) visitAt(rawURL string, depth int) error {
+
+	if c.MaxDepth >= 0 && depth > c.MaxDepth {
+		return nil
+	}
+
+	if !c.allowed(rawURL) {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.visited[rawURL] {
+		c.mu.Unlock()
+		return nil
+	}
+	c.visited[rawURL] = true
+	c.mu.Unlock()
+
+	c.once.Do(c.start)
+
+	// Enqueueing happens on its own goroutine so that a worker calling
+	// visitAt from inside dispatchHTML (to follow a discovered link)
+	// never blocks on a full queue waiting for itself to drain it.
+	c.wg.Add(1)
+	go func() {
+		c.queue <- visit{url: rawURL, depth: depth}
+	}()
+
+	return nil
+
+}
+
+// Wait blocks until all queued visits, and any visits they in turn
+// enqueued, have completed.
+func (c *Collector) Wait() {
+	c.wg.Wait()
+}
+
+func (c *Collector) allowed(rawURL string) bool {
+
+	if c.Robots != nil && !c.Robots.Allowed(rawURL) {
+		return false
+	}
+
+	if len(c.AllowedDomains) == 0 {
+		return true
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+
+	for _, d := range c.AllowedDomains {
+		if u.Hostname() == d {
+			return true
+		}
+	}
+
+	return false
+
+}
+
+func (c *Collector) start() {
+	for i := 0; i < c.Workers; i++ {
+		go c.worker()
+	}
+}
+
+func (c *Collector) worker() {
+	for v := range c.queue {
+		c.process(v)
+		c.wg.Done()
+	}
+}
+
+func (c *Collector) process(v visit) {
+
+	c.throttle(v.url)
+
+	result, err := c.fetchWithRetry(v.url)
+	if err != nil {
+		for _, fn := range c.errorCallbacks {
+			fn(v.url, err)
+		}
+		return
+	}
+
+	resp := Response{URL: v.url, StatusCode: result.status, Body: result.body, Depth: v.depth}
+	for _, fn := range c.responseCallbacks {
+		fn(resp)
+	}
+
+	root := HTMLParse(result.body)
+	if root.Error != nil {
+		for _, fn := range c.errorCallbacks {
+			fn(v.url, root.Error)
+		}
+		return
+	}
+
+	c.dispatchHTML(root, v.url, v.depth)
+
+}
+
+// dispatchHTML runs the registered OnHTML callbacks against root and
+// follows every discovered link (href attribute of an <a> element),
+// resolving relative URLs against baseURL.
+func (c *Collector) dispatchHTML(root Root, baseURL string, depth int) {
+
+	walk(root.Pointer, func(n *html.Node) {
+
+		if n.Type != html.ElementNode {
+			return
+		}
+
+		w := wrapNode(n)
+
+		for _, cb := range c.htmlCallbacks {
+			if cb.sel.match(n) {
+				cb.fn(w)
+			}
+		}
+
+		if n.Data == "a" {
+			if href, ok := w.Attrs()["href"]; ok && href != "" {
+				if next, err := resolveLink(baseURL, href); err == nil {
+					c.visitAt(next, depth+1)
+				}
+			}
+		}
+
+	})
+
+}
+
+// fetchResult is the outcome of a single successful fetch: the response
+// body plus the real status code it was served with.
+type fetchResult struct {
+	body   string
+	status int
+}
+
+func (c *Collector) fetchWithRetry(rawURL string) (fetchResult, error) {
+
+	var lastErr error
+	var lastResult fetchResult
+
+	for attempt := 0; attempt <= c.MaxRetries; attempt++ {
+
+		if attempt > 0 {
+			backoff := time.Duration(math.Pow(2, float64(attempt-1))) * 100 * time.Millisecond
+			time.Sleep(backoff)
+			c.throttle(rawURL)
+		}
+
+		result, err := c.fetchOnce(rawURL)
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		lastResult = result
+
+	}
+
+	return lastResult, lastErr
+
+}
+
+// fetchOnce performs a single GET for rawURL (optionally as a
+// conditional GET against c.Cache), returning the real HTTP status code
+// alongside the body. A non-2xx status is reported as an error so it
+// reaches OnError instead of being silently treated as a success.
+func (c *Collector) fetchOnce(rawURL string) (fetchResult, error) {
+
+	req, err := c.Session.newRequest("GET", rawURL, nil)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	if c.Cache != nil {
+		if entry, ok := c.Cache.Load(rawURL); ok {
+			if entry.ETag != "" {
+				req.Header.Set("If-None-Match", entry.ETag)
+			}
+			if entry.LastModified != "" {
+				req.Header.Set("If-Modified-Since", entry.LastModified)
+			}
+		}
+	}
+
+	resp, err := c.Session.Client.Do(req)
+	if err != nil {
+		return fetchResult{}, errReq(rawURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && c.Cache != nil {
+		entry, _ := c.Cache.Load(rawURL)
+		return fetchResult{body: entry.Body, status: resp.StatusCode}, nil
+	}
+
+	body, err := c.Session.readBody(resp)
+	if err != nil {
+		return fetchResult{}, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fetchResult{body: body, status: resp.StatusCode},
+			fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, rawURL)
+	}
+
+	if c.Cache != nil {
+		c.Cache.Store(rawURL, CacheEntry{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Body:         body,
+		})
+	}
+
+	return fetchResult{body: body, status: resp.StatusCode}, nil
+
+}
+
+func (c *Collector) throttle(rawURL string) {
+
+	if c.RateLimit <= 0 {
+		return
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	host := u.Hostname()
+
+	// Each request reserves the next free slot for its host, so concurrent
+	// workers end up RateLimit apart instead of waking up together.
+	now := time.Now()
+	c.mu.Lock()
+	next := now
+	if last, ok := c.hostHit[host]; ok && last.Add(c.RateLimit).After(now) {
+		next = last.Add(c.RateLimit)
+	}
+	c.hostHit[host] = next
+	c.mu.Unlock()
+
+	time.Sleep(time.Until(next))
+
+}
+
+// resolveLink resolves href, which may be relative, against baseURL.
+func resolveLink(baseURL, href string) (string, error) {
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(ref).String(), nil
+
+}
@@ -0,0 +1,41 @@
+package soup
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCollectorDefaultMaxDepthVisitsSeedOnly(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		fmt.Fprint(w, `<html><body><a href="/page2">next</a></body></html>`)
+	}))
+	defer srv.Close()
+
+	c := NewCollector()
+	c.Visit(srv.URL + "/")
+	c.Wait()
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("got %d requests, want 1 (depth 0 should only visit the seed)", got)
+	}
+}
+
+func TestCollectorUsesOwnSession(t *testing.T) {
+	s := NewSession()
+	s.Header("X-Test", "one")
+
+	c1 := NewCollector(WithSession(s))
+	c2 := NewCollector()
+
+	if c1.Session != s {
+		t.Fatalf("WithSession did not set the Collector's Session")
+	}
+	if c1.Session == c2.Session {
+		t.Fatalf("two Collectors unexpectedly share a Session")
+	}
+}
@@ -0,0 +1,232 @@
+package soup
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// SetAttr sets the attribute named k to v on the element, adding it if it
+// doesn't already exist.
+func (r Root) SetAttr(k, v string) Root {
+
+	if r.Pointer.Type != html.ElementNode {
+		return wrapErrf("cannot set attribute `%s` on a non-element node", k)
+	}
+
+	for i, attr := range r.Pointer.Attr {
+		if attr.Key == k {
+			r.Pointer.Attr[i].Val = v
+			return r
+		}
+	}
+
+	r.Pointer.Attr = append(r.Pointer.Attr, html.Attribute{Key: k, Val: v})
+
+	return r
+
+}
+
+// RemoveAttr removes the attribute named k from the element, if present.
+func (r Root) RemoveAttr(k string) Root {
+
+	if r.Pointer.Type != html.ElementNode {
+		return wrapErrf("cannot remove attribute `%s` from a non-element node", k)
+	}
+
+	attrs := r.Pointer.Attr
+	for i, attr := range attrs {
+		if attr.Key == k {
+			r.Pointer.Attr = append(attrs[:i], attrs[i+1:]...)
+			break
+		}
+	}
+
+	return r
+
+}
+
+// AppendChild appends child as the last child of r.
+func (r Root) AppendChild(child Root) Root {
+
+	if child.Pointer.Parent != nil {
+		child.Pointer.Parent.RemoveChild(child.Pointer)
+	}
+
+	r.Pointer.AppendChild(child.Pointer)
+
+	return r
+
+}
+
+// RemoveChild removes child from r's children. child must be a direct
+// child of r.
+func (r Root) RemoveChild(child Root) Root {
+
+	if child.Pointer.Parent != r.Pointer {
+		return wrapErrf("node is not a child of this element")
+	}
+
+	r.Pointer.RemoveChild(child.Pointer)
+
+	return r
+
+}
+
+// ReplaceWith replaces r in its parent's children with replacement. r
+// must have a parent.
+func (r Root) ReplaceWith(replacement Root) Root {
+
+	if r.Pointer.Parent == nil {
+		return wrapErrf("node has no parent to replace it in")
+	}
+
+	if replacement.Pointer.Parent != nil {
+		replacement.Pointer.Parent.RemoveChild(replacement.Pointer)
+	}
+
+	r.Pointer.Parent.InsertBefore(replacement.Pointer, r.Pointer)
+	r.Pointer.Parent.RemoveChild(r.Pointer)
+
+	return replacement
+
+}
+
+// SetText replaces the contents of r with a single text node containing
+// s, discarding any existing children.
+func (r Root) SetText(s string) Root {
+
+	for c := r.Pointer.FirstChild; c != nil; {
+		next := c.NextSibling
+		r.Pointer.RemoveChild(c)
+		c = next
+	}
+
+	r.Pointer.AppendChild(&html.Node{
+		Type: html.TextNode,
+		Data: s,
+	})
+
+	return r
+
+}
+
+// ParseFragment parses s as an HTML fragment in the context of the given
+// element (e.g. a `<tbody>` Root when parsing `<tr>` fragments) and
+// returns the resulting top-level nodes, wrapping html.ParseFragment.
+func ParseFragment(s string, context Root) ([]Root, error) {
+
+	nodes, err := html.ParseFragment(strings.NewReader(s), context.Pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := make([]Root, len(nodes))
+	for i, n := range nodes {
+		ps[i] = wrapNode(n)
+	}
+
+	return ps, nil
+
+}
+
+// Render serializes r and its descendants back to an HTML string.
+func (r Root) Render() (string, error) {
+
+	s := &strings.Builder{}
+	if err := r.RenderTo(s); err != nil {
+		return "", err
+	}
+
+	return s.String(), nil
+
+}
+
+// RenderTo serializes r and its descendants as HTML to w.
+func (r Root) RenderTo(w io.Writer) error {
+	return html.Render(w, r.Pointer)
+}
+
+// SanitizePolicy controls which tags and attributes Sanitize strips from
+// a tree.
+type SanitizePolicy struct {
+	// DisallowedTags lists element names to remove entirely, along with
+	// their children.
+	DisallowedTags []string
+	// DisallowedAttrPrefixes lists attribute name prefixes to strip from
+	// every remaining element (e.g. "on" removes onclick, onload, ...).
+	DisallowedAttrPrefixes []string
+}
+
+// DefaultSanitizePolicy strips `<script>` and `<style>` elements and any
+// `on*` event-handler attribute. Attribute values are not inspected, so
+// `javascript:` URLs in attributes such as href or src are kept, and
+// other elements (e.g. `<iframe>`, `<object>`) are left in place.
+func DefaultSanitizePolicy() SanitizePolicy {
+	return SanitizePolicy{
+		DisallowedTags:         []string{"script", "style"},
+		DisallowedAttrPrefixes: []string{"on"},
+	}
+}
+
+// Sanitize walks r's subtree, removing any element whose tag is listed in
+// policy.DisallowedTags (together with its children) and stripping any
+// attribute whose name starts with one of policy.DisallowedAttrPrefixes
+// from the elements that remain.
+func (r Root) Sanitize(policy SanitizePolicy) {
+
+	disallowedTag := make(map[string]bool, len(policy.DisallowedTags))
+	for _, t := range policy.DisallowedTags {
+		disallowedTag[t] = true
+	}
+
+	var walkSanitize func(n *html.Node)
+	walkSanitize = func(n *html.Node) {
+
+		c := n.FirstChild
+		for c != nil {
+			next := c.NextSibling
+
+			if c.Type == html.ElementNode && disallowedTag[c.Data] {
+				n.RemoveChild(c)
+				c = next
+				continue
+			}
+
+			if c.Type == html.ElementNode {
+				stripAttrs(c, policy.DisallowedAttrPrefixes)
+				walkSanitize(c)
+			}
+
+			c = next
+		}
+
+	}
+
+	if r.Pointer.Type == html.ElementNode {
+		stripAttrs(r.Pointer, policy.DisallowedAttrPrefixes)
+	}
+	walkSanitize(r.Pointer)
+
+}
+
+func stripAttrs(n *html.Node, prefixes []string) {
+
+	kept := n.Attr[:0]
+	for _, attr := range n.Attr {
+		drop := false
+		for _, p := range prefixes {
+			if strings.HasPrefix(attr.Key, p) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			kept = append(kept, attr)
+		}
+	}
+
+	n.Attr = kept
+
+}
@@ -0,0 +1,364 @@
+package soup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// RobotsPolicy fetches and caches robots.txt per host, and reports
+// whether a given URL may be fetched by a particular user agent. It is
+// safe for concurrent use, so a single RobotsPolicy can be shared across
+// a Collector's worker pool.
+type RobotsPolicy struct {
+	UserAgent string
+
+	mu    sync.Mutex
+	rules map[string]*robotsRules // keyed by host
+}
+
+// NewRobotsPolicy creates a RobotsPolicy that evaluates rules for the
+// given user agent (e.g. "MyBot").
+func NewRobotsPolicy(userAgent string) *RobotsPolicy {
+	return &RobotsPolicy{
+		UserAgent: userAgent,
+		rules:     make(map[string]*robotsRules),
+	}
+}
+
+// Allowed reports whether rawURL may be fetched according to the
+// robots.txt served by its host, fetching and caching that robots.txt the
+// first time the host is seen. If robots.txt can't be fetched or parsed,
+// Allowed fails open and returns true.
+func (p *RobotsPolicy) Allowed(rawURL string) bool {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return true
+	}
+
+	rules := p.rulesFor(u)
+	if rules == nil {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return rules.allows(p.UserAgent, path)
+
+}
+
+func (p *RobotsPolicy) rulesFor(u *url.URL) *robotsRules {
+
+	host := u.Hostname()
+
+	p.mu.Lock()
+	rules, ok := p.rules[host]
+	p.mu.Unlock()
+	if ok {
+		return rules
+	}
+
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	body, err := DefaultSession.Get(robotsURL)
+
+	var parsed *robotsRules
+	if err == nil {
+		parsed = parseRobots(body)
+	}
+
+	p.mu.Lock()
+	p.rules[host] = parsed
+	p.mu.Unlock()
+
+	return parsed
+
+}
+
+// robotsRules holds the Disallow/Allow prefixes declared for each
+// user-agent group in a robots.txt file.
+type robotsRules struct {
+	groups map[string][]robotsRule // lowercased user-agent -> rules, in file order
+}
+
+type robotsRule struct {
+	allow  bool
+	prefix string
+}
+
+func parseRobots(body string) *robotsRules {
+
+	rules := &robotsRules{groups: make(map[string][]robotsRule)}
+	var current []string
+	sawRule := false
+
+	for _, line := range strings.Split(body, "\n") {
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			// A blank line ends the current record group.
+			current = nil
+			sawRule = false
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// A User-agent line after rules starts a new record group.
+			if sawRule {
+				current = nil
+				sawRule = false
+			}
+			ua := strings.ToLower(value)
+			current = append(current, ua)
+			if _, ok := rules.groups[ua]; !ok {
+				rules.groups[ua] = nil
+			}
+		case "disallow":
+			sawRule = true
+			if value != "" {
+				for _, ua := range current {
+					rules.groups[ua] = append(rules.groups[ua], robotsRule{allow: false, prefix: value})
+				}
+			}
+		case "allow":
+			sawRule = true
+			for _, ua := range current {
+				rules.groups[ua] = append(rules.groups[ua], robotsRule{allow: true, prefix: value})
+			}
+		}
+		// Unrecognized directives (Crawl-delay, Sitemap, Host, ...) are
+		// ignored but don't end the current record group.
+
+	}
+
+	return rules
+
+}
+
+// allows reports whether path is allowed for userAgent, using the most
+// specific matching Disallow/Allow prefix rule; the user agent's own
+// group takes precedence over the wildcard "*" group.
+func (r *robotsRules) allows(userAgent, path string) bool {
+
+	group, ok := r.groups[strings.ToLower(userAgent)]
+	if !ok {
+		group, ok = r.groups["*"]
+		if !ok {
+			return true
+		}
+	}
+
+	allowed := true
+	longest := -1
+
+	for _, rule := range group {
+		if !strings.HasPrefix(path, rule.prefix) {
+			continue
+		}
+		if len(rule.prefix) > longest {
+			longest = len(rule.prefix)
+			allowed = rule.allow
+		}
+	}
+
+	return allowed
+
+}
+
+// Sitemap fetches the sitemap (or gzipped sitemap) at url and returns the
+// URLs it lists, recursing into any nested sitemaps referenced by a
+// <sitemapindex>.
+func Sitemap(rawURL string) ([]string, error) {
+	return sitemap(rawURL, make(map[string]bool))
+}
+
+func sitemap(rawURL string, seen map[string]bool) ([]string, error) {
+
+	if seen[rawURL] {
+		return nil, nil
+	}
+	seen[rawURL] = true
+
+	body, err := fetchSitemapBody(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err == nil && len(index.Sitemaps) > 0 {
+		var urls []string
+		for _, s := range index.Sitemaps {
+			nested, err := sitemap(s.Loc, seen)
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, nested...)
+		}
+		return urls, nil
+	}
+
+	var set urlSet
+	if err := xml.Unmarshal(body, &set); err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, len(set.URLs))
+	for i, u := range set.URLs {
+		urls[i] = u.Loc
+	}
+
+	return urls, nil
+
+}
+
+func fetchSitemapBody(rawURL string) ([]byte, error) {
+
+	body, err := DefaultSession.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(rawURL, ".gz") {
+		gz, err := gzip.NewReader(strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+
+		var out bytes.Buffer
+		if _, err := out.ReadFrom(gz); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	return []byte(body), nil
+
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// CacheEntry is a single cached response, as stored and retrieved by a
+// Cache for conditional GET support.
+type CacheEntry struct {
+	ETag         string
+	LastModified string
+	Body         string
+}
+
+// Cache is the interface a conditional-GET cache must implement. It lets
+// periodic scrapers plug in their own storage (memory, disk, Redis, ...)
+// so unchanged pages don't need to be re-downloaded.
+type Cache interface {
+	Load(key string) (CacheEntry, bool)
+	Store(key string, entry CacheEntry)
+}
+
+// MemoryCache is a Cache backed by an in-process map, suitable for
+// short-lived scrapers or tests.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+// NewMemoryCache creates an empty MemoryCache.
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]CacheEntry)}
+}
+
+// Load implements Cache.
+func (c *MemoryCache) Load(key string) (CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// Store implements Cache.
+func (c *MemoryCache) Store(key string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+// GetConditional performs a conditional GET against rawURL: if cache
+// holds a previous response for it, If-None-Match/If-Modified-Since are
+// sent along, and a 304 response returns the cached body without
+// re-downloading it. Otherwise the response is fetched normally and
+// stored in cache for next time.
+func (s *Session) GetConditional(cache Cache, rawURL string) (string, error) {
+
+	req, err := s.newRequest("GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if entry, ok := cache.Load(rawURL); ok {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", errReq(rawURL)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 304 {
+		entry, _ := cache.Load(rawURL)
+		return entry.Body, nil
+	}
+
+	body, err := s.readBody(resp)
+	if err != nil {
+		return "", err
+	}
+
+	cache.Store(rawURL, CacheEntry{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	})
+
+	return body, nil
+
+}
+
+// GetConditional performs a conditional GET through DefaultSession. See
+// Session.GetConditional.
+func GetConditional(cache Cache, rawURL string) (string, error) {
+	return DefaultSession.GetConditional(cache, rawURL)
+}
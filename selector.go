@@ -0,0 +1,638 @@
+package soup
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	errNoSelector    = errors.New("empty selector")
+	errUnclosedAttr  = errors.New("unclosed `[` in selector")
+	errUnknownPseudo = errors.New("unknown pseudo-class")
+	errInvalidNth    = errors.New("invalid An+B expression")
+)
+
+// Select finds all elements in the DOM matching the given CSS selector
+// and returns an array of structs, each having the respective pointers.
+//
+// Select supports a substantial subset of CSS selectors: type, #id, .class
+// and attribute selectors ([k], [k=v], [k~=v], [k^=v], [k$=v], [k*=v]),
+// the descendant, child (>), adjacent sibling (+) and general sibling (~)
+// combinators, comma-separated selector groups, and the :first-child,
+// :last-child, :nth-child(An+B) and :not(...) pseudo-classes.
+func (r Root) Select(selector string) []Root {
+
+	sel, err := compileSelector(selector)
+	if err != nil {
+		return nil
+	}
+
+	var found []*html.Node
+	walk(r.Pointer, func(n *html.Node) {
+		if n.Type == html.ElementNode && sel.match(n) {
+			found = append(found, n)
+		}
+	})
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	ps := make([]Root, len(found))
+	for i, n := range found {
+		ps[i] = wrapNode(n)
+	}
+
+	return ps
+
+}
+
+// SelectOne finds the first element in the DOM matching the given CSS
+// selector and returns a struct with a pointer to it. See Select for the
+// supported selector syntax.
+func (r Root) SelectOne(selector string) Root {
+
+	sel, err := compileSelector(selector)
+	if err != nil {
+		return wrapErrf("invalid selector `%s`: %s", selector, err)
+	}
+
+	var found *html.Node
+	walkUntil(r.Pointer, func(n *html.Node) bool {
+		if n.Type == html.ElementNode && sel.match(n) {
+			found = n
+			return true
+		}
+		return false
+	})
+
+	if found == nil {
+		return wrapErrf("no element found matching selector `%s`", selector)
+	}
+
+	return wrapNode(found)
+
+}
+
+// walk performs a depth first traversal of the DOM starting at n, calling
+// fn for every node visited (including n itself).
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+// walkUntil performs a depth first traversal of the DOM starting at n,
+// stopping as soon as fn returns true.
+func walkUntil(n *html.Node, fn func(*html.Node) bool) bool {
+	if fn(n) {
+		return true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if walkUntil(c, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// combinator describes how a compound selector relates to the one before it.
+type combinator int
+
+const (
+	combinatorNone        combinator = iota // first compound in the selector
+	combinatorDescendant                    // "  " (whitespace)
+	combinatorChild                         // >
+	combinatorNextSibling                   // +
+	combinatorSibling                       // ~
+)
+
+// selectorGroup is a comma-separated list of selectors; it matches a node
+// if any of its members match.
+type selectorGroup []*compoundChain
+
+func compileSelector(s string) (selectorGroup, error) {
+
+	var group selectorGroup
+	for _, part := range splitTopLevel(s, ',') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		chain, err := compileChain(part)
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, chain)
+	}
+
+	return group, nil
+
+}
+
+func (g selectorGroup) match(n *html.Node) bool {
+	for _, chain := range g {
+		if chain.match(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// compoundChain is a single selector such as "div.foo > span#bar".
+type compoundChain struct {
+	combinator combinator
+	compound   *compound
+	prev       *compoundChain
+}
+
+func compileChain(s string) (*compoundChain, error) {
+
+	tokens, err := tokenizeSelector(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var chain *compoundChain
+	comb := combinatorNone
+
+	for _, tok := range tokens {
+		switch tok {
+		case ">":
+			comb = combinatorChild
+		case "+":
+			comb = combinatorNextSibling
+		case "~":
+			comb = combinatorSibling
+		default:
+			cp, err := compileCompound(tok)
+			if err != nil {
+				return nil, err
+			}
+			chain = &compoundChain{combinator: comb, compound: cp, prev: chain}
+			comb = combinatorDescendant
+		}
+	}
+
+	if chain == nil {
+		return nil, errNoSelector
+	}
+
+	return chain, nil
+
+}
+
+func (c *compoundChain) match(n *html.Node) bool {
+
+	if !c.compound.match(n) {
+		return false
+	}
+
+	if c.prev == nil {
+		return true
+	}
+
+	switch c.combinator {
+	case combinatorChild:
+		p := n.Parent
+		return p != nil && c.prev.match(p)
+	case combinatorNextSibling:
+		p := prevElementSibling(n)
+		return p != nil && c.prev.match(p)
+	case combinatorSibling:
+		for p := prevElementSibling(n); p != nil; p = prevElementSibling(p) {
+			if c.prev.match(p) {
+				return true
+			}
+		}
+		return false
+	default: // descendant
+		for p := n.Parent; p != nil; p = p.Parent {
+			if c.prev.match(p) {
+				return true
+			}
+		}
+		return false
+	}
+
+}
+
+func prevElementSibling(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// compound is a single compound selector such as "div.foo#bar[baz]".
+type compound struct {
+	tag     string
+	simples []simpleSelector
+}
+
+type simpleSelector interface {
+	match(n *html.Node) bool
+}
+
+func compileCompound(tok string) (*compound, error) {
+
+	cp := &compound{}
+
+	for len(tok) > 0 {
+		switch tok[0] {
+		case '#':
+			end := simpleSelectorEnd(tok[1:])
+			cp.simples = append(cp.simples, idSelector(tok[1:1+end]))
+			tok = tok[1+end:]
+		case '.':
+			end := simpleSelectorEnd(tok[1:])
+			cp.simples = append(cp.simples, classSelector(tok[1:1+end]))
+			tok = tok[1+end:]
+		case '[':
+			end := strings.IndexByte(tok, ']')
+			if end < 0 {
+				return nil, errUnclosedAttr
+			}
+			sel, err := compileAttrSelector(tok[1:end])
+			if err != nil {
+				return nil, err
+			}
+			cp.simples = append(cp.simples, sel)
+			tok = tok[end+1:]
+		case ':':
+			name, arg, rest := parsePseudo(tok[1:])
+			sel, err := compilePseudoSelector(name, arg)
+			if err != nil {
+				return nil, err
+			}
+			cp.simples = append(cp.simples, sel)
+			tok = rest
+		default:
+			end := simpleSelectorEnd(tok)
+			name := tok[:end]
+			if name != "*" && name != "" {
+				cp.tag = name
+			}
+			tok = tok[end:]
+		}
+	}
+
+	return cp, nil
+
+}
+
+// simpleSelectorEnd returns the length of the leading run of characters
+// that make up a tag/id/class name (i.e. up to the next combinator-like
+// special character).
+func simpleSelectorEnd(s string) int {
+	for i, r := range s {
+		switch r {
+		case '#', '.', '[', ':':
+			return i
+		}
+	}
+	return len(s)
+}
+
+func parsePseudo(s string) (name, arg, rest string) {
+
+	i := 0
+	for i < len(s) && s[i] != '(' && s[i] != '.' && s[i] != '#' && s[i] != '[' && s[i] != ':' {
+		i++
+	}
+	name = s[:i]
+
+	if i < len(s) && s[i] == '(' {
+		end := strings.IndexByte(s[i:], ')')
+		if end < 0 {
+			return name, "", ""
+		}
+		arg = s[i+1 : i+end]
+		return name, arg, s[i+end+1:]
+	}
+
+	return name, "", s[i:]
+
+}
+
+func (c *compound) match(n *html.Node) bool {
+
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+
+	for _, s := range c.simples {
+		if !s.match(n) {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+type idSelector string
+
+func (id idSelector) match(n *html.Node) bool {
+	return getKeyValue(n.Attr)["id"] == string(id)
+}
+
+type classSelector string
+
+func (cl classSelector) match(n *html.Node) bool {
+	classes := strings.Fields(getKeyValue(n.Attr)["class"])
+	for _, c := range classes {
+		if c == string(cl) {
+			return true
+		}
+	}
+	return false
+}
+
+type attrSelector struct {
+	key string
+	op  string // "", "=", "~=", "^=", "$=", "*="
+	val string
+}
+
+func compileAttrSelector(s string) (*attrSelector, error) {
+
+	for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+		if i := strings.Index(s, op); i >= 0 {
+			return &attrSelector{
+				key: strings.TrimSpace(s[:i]),
+				op:  op,
+				val: unquote(strings.TrimSpace(s[i+len(op):])),
+			}, nil
+		}
+	}
+
+	return &attrSelector{key: strings.TrimSpace(s)}, nil
+
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (a *attrSelector) match(n *html.Node) bool {
+
+	val, ok := getKeyValue(n.Attr)[a.key]
+	if !ok {
+		return false
+	}
+
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return val == a.val
+	case "~=":
+		for _, f := range strings.Fields(val) {
+			if f == a.val {
+				return true
+			}
+		}
+		return false
+	case "^=":
+		return strings.HasPrefix(val, a.val)
+	case "$=":
+		return strings.HasSuffix(val, a.val)
+	case "*=":
+		return strings.Contains(val, a.val)
+	}
+
+	return false
+
+}
+
+func compilePseudoSelector(name, arg string) (simpleSelector, error) {
+
+	switch name {
+	case "first-child":
+		return positionalFunc(func(n *html.Node) bool {
+			return elementIndex(n) == 0
+		}), nil
+	case "last-child":
+		return positionalFunc(func(n *html.Node) bool {
+			return nextElementSibling(n) == nil
+		}), nil
+	case "nth-child":
+		a, b, err := parseNth(arg)
+		if err != nil {
+			return nil, err
+		}
+		return positionalFunc(func(n *html.Node) bool {
+			idx := elementIndex(n) + 1 // nth-child is 1-indexed
+			if a == 0 {
+				return idx == b
+			}
+			k := idx - b
+			return k%a == 0 && k/a >= 0
+		}), nil
+	case "not":
+		inner, err := compileChain(arg)
+		if err != nil {
+			return nil, err
+		}
+		not := func(n *html.Node) bool {
+			return !inner.compound.match(n)
+		}
+		for _, s := range inner.compound.simples {
+			if p, ok := s.(positionalSelector); ok && p.positional() {
+				return positionalFunc(not), nil
+			}
+		}
+		return pseudoFunc(not), nil
+	}
+
+	return nil, errUnknownPseudo
+
+}
+
+type pseudoFunc func(*html.Node) bool
+
+func (f pseudoFunc) match(n *html.Node) bool { return f(n) }
+
+// positionalFunc is a simpleSelector whose match result depends on a
+// node's position among its siblings (:first-child, :last-child,
+// :nth-child, and :not(...) around one of those). Such selectors can't
+// be evaluated correctly by Stream, which usually detaches each element
+// from its siblings as soon as it is dispatched; see positionalSelector.
+type positionalFunc func(*html.Node) bool
+
+func (f positionalFunc) match(n *html.Node) bool { return f(n) }
+func (f positionalFunc) positional() bool        { return true }
+
+// positionalSelector is implemented by simpleSelectors that need intact
+// sibling pointers to match correctly.
+type positionalSelector interface {
+	positional() bool
+}
+
+// hasPositional reports whether g uses a sibling combinator (+, ~) or a
+// positional pseudo-class (:first-child, :last-child, :nth-child)
+// anywhere in its chains. Stream.OnSelector rejects such selectors,
+// since they require sibling pointers that Stream's incremental,
+// memory-bounded parsing doesn't keep intact.
+func (g selectorGroup) hasPositional() bool {
+	for _, chain := range g {
+		for c := chain; c != nil; c = c.prev {
+			if c.combinator == combinatorNextSibling || c.combinator == combinatorSibling {
+				return true
+			}
+			for _, s := range c.compound.simples {
+				if p, ok := s.(positionalSelector); ok && p.positional() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func elementIndex(n *html.Node) int {
+	i := 0
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			i++
+		}
+	}
+	return i
+}
+
+func nextElementSibling(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+// parseNth parses the An+B notation used by :nth-child() and friends.
+func parseNth(s string) (a, b int, err error) {
+
+	s = strings.TrimSpace(strings.ToLower(s))
+
+	switch s {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	i := strings.IndexByte(s, 'n')
+	if i < 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, 0, errInvalidNth
+		}
+		return 0, n, nil
+	}
+
+	aPart := strings.TrimSpace(s[:i])
+	switch aPart {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		a, err = strconv.Atoi(aPart)
+		if err != nil {
+			return 0, 0, errInvalidNth
+		}
+	}
+
+	bPart := strings.TrimSpace(s[i+1:])
+	bPart = strings.ReplaceAll(bPart, " ", "")
+	if bPart == "" {
+		return a, 0, nil
+	}
+
+	b, err = strconv.Atoi(bPart)
+	if err != nil {
+		return 0, 0, errInvalidNth
+	}
+
+	return a, b, nil
+
+}
+
+// tokenizeSelector splits a single (comma-free) selector into compound
+// selectors and combinators, e.g. "div > p.foo" becomes
+// ["div", ">", "p.foo"].
+func tokenizeSelector(s string) ([]string, error) {
+
+	var tokens []string
+	var cur strings.Builder
+	depth := 0
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	runes := []rune(strings.TrimSpace(s))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '(' || r == '[':
+			depth++
+			cur.WriteRune(r)
+		case r == ')' || r == ']':
+			depth--
+			cur.WriteRune(r)
+		case depth > 0:
+			cur.WriteRune(r)
+		case r == '>' || r == '+' || r == '~':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens, nil
+
+}
+
+// splitTopLevel splits s on sep, ignoring occurrences inside [] or ().
+func splitTopLevel(s string, sep byte) []string {
+
+	var parts []string
+	depth := 0
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[start:])
+
+	return parts
+
+}
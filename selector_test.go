@@ -0,0 +1,12 @@
+package soup
+
+import "testing"
+
+func TestSelectAttributeValueWithSpace(t *testing.T) {
+	root := HTMLParse(`<html><body><p class="foo bar">hi</p></body></html>`)
+
+	found := root.Select(`p[class="foo bar"]`)
+	if len(found) != 1 {
+		t.Fatalf("got %d matches, want 1", len(found))
+	}
+}
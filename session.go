@@ -0,0 +1,213 @@
+package soup
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Session owns everything needed to perform HTTP requests on behalf of a
+// scraper: an *http.Client (with its own cookie jar, timeout and proxy),
+// a set of headers sent with every request, and a User-Agent override.
+// Unlike the package-level Header/Cookie helpers, a Session's state is
+// only shared by callers that explicitly share the Session, which makes
+// it safe to run several scrapers concurrently with different
+// configuration.
+//
+// Gzip-encoded responses are decoded transparently by the underlying
+// net/http transport as long as Accept-Encoding isn't set manually;
+// brotli ("br") isn't decoded, since it isn't supported by the Go
+// standard library.
+type Session struct {
+	Client    *http.Client
+	UserAgent string
+
+	mu      sync.RWMutex
+	headers map[string]string
+	cookies map[string]string
+}
+
+// DefaultSession is the Session used by the package-level Get, Header,
+// Cookie, etc. helpers, kept for backward compatibility with code written
+// against earlier versions of this package.
+var DefaultSession = NewSession()
+
+// NewSession creates a Session with its own *http.Client and cookie jar.
+func NewSession() *Session {
+
+	jar, _ := cookiejar.New(nil)
+
+	return &Session{
+		Client:  &http.Client{Jar: jar},
+		headers: make(map[string]string),
+		cookies: make(map[string]string),
+	}
+
+}
+
+// Header sets a header to be sent with every request made through s.
+func (s *Session) Header(n, v string) {
+	s.mu.Lock()
+	s.headers[n] = v
+	s.mu.Unlock()
+}
+
+// Cookie sets a cookie to be sent with every request made through s,
+// regardless of the request's host. For cookies that should only be sent
+// to a specific host, populate s.Client.Jar instead.
+func (s *Session) Cookie(n, v string) {
+	s.mu.Lock()
+	s.cookies[n] = v
+	s.mu.Unlock()
+}
+
+// SetTimeout sets the timeout applied to every request made through s.
+func (s *Session) SetTimeout(d time.Duration) {
+	s.Client.Timeout = d
+}
+
+// SetProxy routes every request made through s via the given proxy URL.
+func (s *Session) SetProxy(rawURL string) error {
+
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	transport, ok := s.Client.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = &http.Transport{}
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	s.Client.Transport = transport
+
+	return nil
+
+}
+
+func (s *Session) newRequest(method, rawURL string, body io.Reader) (*http.Request, error) {
+
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, errReq(rawURL)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name, val := range s.headers {
+		req.Header.Set(name, val)
+	}
+
+	for name, val := range s.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: val})
+	}
+
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+
+	return req, nil
+
+}
+
+// GetWithClient returns the HTML returned by the url using a provided
+// HTTP client, with s's headers and cookies applied.
+func (s *Session) GetWithClient(rawURL string, client *http.Client) (string, error) {
+
+	req, err := s.newRequest("GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errReq(rawURL)
+	}
+	defer resp.Body.Close()
+
+	return s.readBody(resp)
+
+}
+
+// Get returns the HTML returned by the url using s's HTTP client.
+func (s *Session) Get(rawURL string) (string, error) {
+	return s.GetWithClient(rawURL, s.Client)
+}
+
+// Post performs a POST request to url with the given content type and
+// body, returning the response body.
+func (s *Session) Post(rawURL, contentType string, body io.Reader) (string, error) {
+
+	req, err := s.newRequest("POST", rawURL, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", errors.New("couldn't perform POST request to " + rawURL)
+	}
+	defer resp.Body.Close()
+
+	return s.readBody(resp)
+
+}
+
+func (s *Session) readBody(resp *http.Response) (string, error) {
+
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.New("unable to read the response body")
+	}
+
+	return string(bytes), nil
+
+}
+
+// GetStream performs a GET request to url and returns a Stream reading
+// directly from the response body, without buffering the whole response
+// in memory first like Get does. The caller must drain the Stream (via
+// Run) so the underlying response body gets closed.
+func (s *Session) GetStream(rawURL string) (*Stream, error) {
+
+	req, err := s.newRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, errReq(rawURL)
+	}
+
+	stream := NewStream(resp.Body)
+	stream.closer = resp.Body
+
+	return stream, nil
+
+}
+
+// GetParsed performs a GET request to url and parses the result, in one
+// call, returning a Root the same way HTMLParse(Get(url)) would but
+// without discarding a request error into the Root's Error field.
+func (s *Session) GetParsed(rawURL string) (Root, error) {
+
+	body, err := s.Get(rawURL)
+	if err != nil {
+		return Root{}, err
+	}
+
+	return HTMLParse(body), nil
+
+}
+
+func errReq(rawURL string) error {
+	return errors.New("couldn't perform GET request to " + rawURL)
+}
@@ -5,9 +5,7 @@ keeping it as similar as possible to BeautifulSoup
 package soup
 
 import (
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
 
@@ -38,61 +36,31 @@ func wrapErrf(format string, a ...interface{}) Root {
 	return wrapErr(fmt.Errorf(format, a...))
 }
 
-// Headers contains all HTTP headers to send
-var Headers = make(map[string]string)
-
-// Cookies contains all HTTP cookies to send
-var Cookies = make(map[string]string)
-
-// Header sets a new HTTP header
+// Header sets a new HTTP header to be sent with every request made
+// through DefaultSession. It is kept as a thin wrapper around
+// DefaultSession.Header for backward compatibility; new code that needs
+// isolated configuration should create its own Session instead.
 func Header(n string, v string) {
-	Headers[n] = v
+	DefaultSession.Header(n, v)
 }
 
-// Cookie sets a cookie to send
+// Cookie sets a cookie to send with every request made through
+// DefaultSession. See Header.
 func Cookie(n string, v string) {
-	Cookies[n] = v
+	DefaultSession.Cookie(n, v)
 }
 
-// GetWithClient returns the HTML returned by the url using a provided HTTP client
+// GetWithClient returns the HTML returned by the url using a provided HTTP
+// client, with DefaultSession's headers and cookies applied. It is kept
+// as a thin wrapper around DefaultSession.GetWithClient for backward
+// compatibility.
 func GetWithClient(url string, client *http.Client) (string, error) {
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", errors.New("couldn't perform GET request to " + url)
-	}
-
-	// Set headers
-	for name, val := range Headers {
-		req.Header.Set(name, val)
-	}
-
-	// Set cookies
-	for name, val := range Cookies {
-		req.AddCookie(&http.Cookie{
-			Name:  name,
-			Value: val,
-		})
-	}
-
-	// Perform request
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", errors.New("couldn't perform GET request to " + url)
-	}
-	defer resp.Body.Close()
-
-	bytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", errors.New("unable to read the response body")
-	}
-
-	return string(bytes), nil
+	return DefaultSession.GetWithClient(url, client)
 }
 
-// Get returns the HTML returned by the url in string using the default HTTP client
+// Get returns the HTML returned by the url in string using DefaultSession.
 func Get(url string) (string, error) {
-	return GetWithClient(url, http.DefaultClient)
+	return DefaultSession.Get(url)
 }
 
 // HTMLParse parses the HTML returning a start pointer to the DOM
@@ -0,0 +1,209 @@
+package soup
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// errPositionalSelector is returned by OnSelector for selectors that
+// depend on sibling position (+, ~, :first-child, :last-child,
+// :nth-child). Run detaches each element from its parent as soon as its
+// end tag is seen, to keep memory bounded, which severs the sibling
+// pointers these selectors need; they would otherwise silently match
+// nothing (or, for :first-child, match incorrectly). Use Select/SelectOne
+// against a fully parsed Root instead.
+var errPositionalSelector = errors.New("soup: selector uses sibling position (+, ~, :first-child, :last-child, :nth-child), which Stream can't evaluate correctly; use HTMLParse and Select instead")
+
+// callback pairs a matcher (either a plain tag name or a compiled CSS
+// selector) with the function to invoke when it matches.
+type callback struct {
+	tag string
+	sel selectorGroup
+	fn  func(Root)
+}
+
+func (c callback) match(n *html.Node) bool {
+	if c.sel != nil {
+		return c.sel.match(n)
+	}
+	return n.Data == c.tag
+}
+
+// Stream parses an HTML document incrementally using html.Tokenizer,
+// invoking registered callbacks as matching elements are parsed, instead
+// of building the whole DOM in memory like HTMLParse does. This keeps
+// memory bounded when working with multi-megabyte pages.
+type Stream struct {
+	z         *html.Tokenizer
+	callbacks []callback
+	closer    io.Closer
+}
+
+// NewStream creates a Stream that tokenizes HTML read from r.
+func NewStream(r io.Reader) *Stream {
+	return &Stream{z: html.NewTokenizer(r)}
+}
+
+// GetStream performs a GET request to url using DefaultSession and
+// returns a Stream reading directly from the response body, without
+// buffering the whole response in memory with ioutil.ReadAll first like
+// Get does. It is kept as a thin wrapper around DefaultSession.GetStream
+// for backward compatibility.
+func GetStream(url string) (*Stream, error) {
+	return DefaultSession.GetStream(url)
+}
+
+// OnElement registers fn to be called, with the matched element wrapped
+// as a Root, for every element with the given tag name.
+func (s *Stream) OnElement(tag string, fn func(Root)) {
+	s.callbacks = append(s.callbacks, callback{tag: tag, fn: fn})
+}
+
+// OnSelector registers fn to be called, with the matched element wrapped
+// as a Root, for every element matching the given CSS selector. Matching
+// happens once an element's end tag is seen, so by then its subtree and
+// ancestors are fully built; but Run detaches each element from its
+// parent right after dispatching it unless an enclosing element matches
+// a callback (to keep memory bounded), so preceding siblings are usually
+// already gone by match time. OnSelector rejects
+// selectors that depend on sibling position — the + and ~ combinators
+// and the :first-child, :last-child and :nth-child pseudo-classes — with
+// errPositionalSelector, since they can't be evaluated correctly here;
+// use Select/SelectOne against a fully parsed Root for those instead.
+func (s *Stream) OnSelector(sel string, fn func(Root)) error {
+	compiled, err := compileSelector(sel)
+	if err != nil {
+		return err
+	}
+	if compiled.hasPositional() {
+		return errPositionalSelector
+	}
+	s.callbacks = append(s.callbacks, callback{sel: compiled, fn: fn})
+	return nil
+}
+
+// Run reads and tokenizes the underlying document until EOF, invoking the
+// registered callbacks as matching elements are encountered. It returns
+// any error encountered while tokenizing, other than io.EOF. If the
+// Stream was created via GetStream, Run closes the underlying response
+// body once done.
+func (s *Stream) Run() error {
+
+	if s.closer != nil {
+		defer s.closer.Close()
+	}
+
+	var stack []*html.Node
+
+	// release detaches n unless a still-open ancestor matches a callback,
+	// in which case n is part of a subtree that ancestor will be
+	// dispatched with.
+	release := func(n *html.Node) {
+		for _, a := range stack {
+			for _, cb := range s.callbacks {
+				if cb.match(a) {
+					return
+				}
+			}
+		}
+		detach(n)
+	}
+
+	for {
+		tt := s.z.Next()
+
+		switch tt {
+		case html.ErrorToken:
+			if err := s.z.Err(); err != nil && err != io.EOF {
+				return err
+			}
+			return nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := s.z.Token()
+			n := tokenToNode(tok)
+
+			if len(stack) > 0 {
+				appendChild(stack[len(stack)-1], n)
+			}
+
+			if tt == html.SelfClosingTagToken || voidElement(tok.Data) {
+				s.dispatch(n)
+				release(n)
+			} else {
+				stack = append(stack, n)
+			}
+
+		case html.EndTagToken:
+			if len(stack) > 0 {
+				n := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				s.dispatch(n)
+				release(n)
+			}
+
+		case html.TextToken:
+			if len(stack) > 0 {
+				tok := s.z.Token()
+				appendChild(stack[len(stack)-1], &html.Node{
+					Type: html.TextNode,
+					Data: tok.Data,
+				})
+			}
+		}
+	}
+
+}
+
+func (s *Stream) dispatch(n *html.Node) {
+	for _, cb := range s.callbacks {
+		if cb.match(n) {
+			cb.fn(wrapNode(n))
+		}
+	}
+}
+
+func tokenToNode(tok html.Token) *html.Node {
+	return &html.Node{
+		Type: html.ElementNode,
+		Data: tok.Data,
+		Attr: tok.Attr,
+	}
+}
+
+// detach unlinks n from its parent once it has been dispatched (and no
+// open ancestor matches a callback), so the
+// still-open ancestors on the stack (e.g. <html>/<body>) don't keep
+// accumulating every closed subtree for the rest of the document, which
+// is what keeps Run's memory use bounded rather than building the whole
+// DOM like HTMLParse.
+func detach(n *html.Node) {
+	if n.Parent != nil {
+		n.Parent.RemoveChild(n)
+	}
+}
+
+func appendChild(parent, child *html.Node) {
+	child.Parent = parent
+	if parent.LastChild != nil {
+		parent.LastChild.NextSibling = child
+		child.PrevSibling = parent.LastChild
+	} else {
+		parent.FirstChild = child
+	}
+	parent.LastChild = child
+}
+
+// voidElement reports whether tag is one of the HTML void elements that
+// never have an end tag and therefore should not be pushed onto the
+// open-element stack.
+func voidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input",
+		"link", "meta", "param", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
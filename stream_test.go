@@ -0,0 +1,31 @@
+package soup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStreamOnSelectorRejectsPositional(t *testing.T) {
+	for _, sel := range []string{"h1 + p", "p ~ span", "li:first-child", "li:last-child", "li:nth-child(2)"} {
+		s := NewStream(strings.NewReader(""))
+		if err := s.OnSelector(sel, func(Root) {}); err != errPositionalSelector {
+			t.Errorf("OnSelector(%q) error = %v, want errPositionalSelector", sel, err)
+		}
+	}
+}
+
+func TestStreamOnSelectorAcceptsNonPositional(t *testing.T) {
+	html := `<html><body><ul><li>1</li><li>2</li></ul></body></html>`
+
+	s := NewStream(strings.NewReader(html))
+	var matched int
+	if err := s.OnSelector("li", func(Root) { matched++ }); err != nil {
+		t.Fatalf("OnSelector: %v", err)
+	}
+	if err := s.Run(); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if matched != 2 {
+		t.Fatalf("matched %d elements, want 2", matched)
+	}
+}